@@ -0,0 +1,431 @@
+package fsm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+	"github.com/dgouldin/swfsm/fsm/statepb"
+)
+
+// StateCodec marshals and unmarshals the serialization-friendly state of an EventCorrelator, so it can be
+// stuffed into SWF's 32KB ExecutionContext / marker payload limits. EventCorrelator's own maps are keyed
+// by strings rather than int64s so that the JSONStateCodec below "just works"; other codecs are free to
+// use a denser encoding.
+type StateCodec interface {
+	Marshal(*EventCorrelator) ([]byte, error)
+	Unmarshal([]byte, *EventCorrelator) error
+}
+
+// legacyJSONCodec decodes the original, unmarked encoding every running workflow's ExecutionContext was
+// written with before StateCodec existed: plain json.Marshal of an EventCorrelator, with no magic-byte
+// prefix at all. DetectingStateCodec uses only its Unmarshal, which accepts such a blob, so operators can
+// switch codecs without breaking workflows that are already mid-flight. Its Marshal is JSONStateCodec's
+// and writes the magicJSON prefix.
+var legacyJSONCodec = JSONStateCodec{}
+
+// Magic bytes identify which StateCodec produced a payload, so DetectingStateCodec can pick the matching
+// Unmarshal implementation without being told out of band which codec wrote it.
+const (
+	magicJSON  = 0x01
+	magicGob   = 0x02
+	magicProto = 0x03
+)
+
+// JSONStateCodec encodes an EventCorrelator as JSON. It writes a magicJSON-prefixed payload, but
+// Unmarshal also accepts an unprefixed legacy JSON blob, so it doubles as the fallback DetectingStateCodec
+// uses for data written before codecs existed.
+type JSONStateCodec struct{}
+
+// Marshal implements StateCodec.
+func (JSONStateCodec) Marshal(c *EventCorrelator) ([]byte, error) {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{magicJSON}, body...), nil
+}
+
+// Unmarshal implements StateCodec.
+func (JSONStateCodec) Unmarshal(data []byte, c *EventCorrelator) error {
+	if len(data) > 0 && data[0] == magicJSON {
+		data = data[1:]
+	}
+	return json.Unmarshal(data, c)
+}
+
+// GobStateCodec encodes an EventCorrelator with encoding/gob, which is denser than JSON for the same
+// data and doesn't require EventCorrelator's maps to be string-keyed.
+type GobStateCodec struct{}
+
+// gobState mirrors EventCorrelator field-for-field, minus HeaderCodec: gob, unlike encoding/json, has no
+// tag to exclude a field, and HeaderCodec is runtime config rather than serialized state anyway (it's
+// also an interface, which gob can't encode without a gob.Register'd concrete type). Marshal/Unmarshal
+// convert to and from this shadow type instead of encoding *EventCorrelator directly.
+type gobState struct {
+	Activities            map[string]*ActivityInfo
+	ActivityAttempts      map[string]int
+	ActivityFirstAttempts map[string]time.Time
+	ActivityRetryPolicies map[string]*RetryPolicy
+	Signals               map[string]*SignalInfo
+	SignalAttempts        map[string]int
+	SignalFirstAttempts   map[string]time.Time
+	SignalRetryPolicies   map[string]*RetryPolicy
+	ChildWorkflows        map[string]*ChildWorkflowInfo
+	ChildWorkflowAttempts map[string]int
+	Timers                map[string]*TimerInfo
+}
+
+// Marshal implements StateCodec.
+func (GobStateCodec) Marshal(c *EventCorrelator) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(magicGob)
+	s := gobState{
+		Activities:            c.Activities,
+		ActivityAttempts:      c.ActivityAttempts,
+		ActivityFirstAttempts: c.ActivityFirstAttempts,
+		ActivityRetryPolicies: c.ActivityRetryPolicies,
+		Signals:               c.Signals,
+		SignalAttempts:        c.SignalAttempts,
+		SignalFirstAttempts:   c.SignalFirstAttempts,
+		SignalRetryPolicies:   c.SignalRetryPolicies,
+		ChildWorkflows:        c.ChildWorkflows,
+		ChildWorkflowAttempts: c.ChildWorkflowAttempts,
+		Timers:                c.Timers,
+	}
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements StateCodec.
+func (GobStateCodec) Unmarshal(data []byte, c *EventCorrelator) error {
+	if len(data) == 0 || data[0] != magicGob {
+		return fmt.Errorf("fsm: data is not a GobStateCodec payload")
+	}
+	var s gobState
+	if err := gob.NewDecoder(bytes.NewReader(data[1:])).Decode(&s); err != nil {
+		return err
+	}
+	c.Activities = s.Activities
+	c.ActivityAttempts = s.ActivityAttempts
+	c.ActivityFirstAttempts = s.ActivityFirstAttempts
+	c.ActivityRetryPolicies = s.ActivityRetryPolicies
+	c.Signals = s.Signals
+	c.SignalAttempts = s.SignalAttempts
+	c.SignalFirstAttempts = s.SignalFirstAttempts
+	c.SignalRetryPolicies = s.SignalRetryPolicies
+	c.ChildWorkflows = s.ChildWorkflows
+	c.ChildWorkflowAttempts = s.ChildWorkflowAttempts
+	c.Timers = s.Timers
+	return nil
+}
+
+// ProtoStateCodec encodes an EventCorrelator as a statepb.State protocol buffer, the densest of the
+// three codecs and the best fit for operators hitting SWF's 32KB ExecutionContext / marker payload limit.
+type ProtoStateCodec struct{}
+
+// Marshal implements StateCodec.
+func (ProtoStateCodec) Marshal(c *EventCorrelator) ([]byte, error) {
+	body, err := proto.Marshal(toProto(c))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{magicProto}, body...), nil
+}
+
+// Unmarshal implements StateCodec.
+func (ProtoStateCodec) Unmarshal(data []byte, c *EventCorrelator) error {
+	if len(data) == 0 || data[0] != magicProto {
+		return fmt.Errorf("fsm: data is not a ProtoStateCodec payload")
+	}
+	var s statepb.State
+	if err := proto.Unmarshal(data[1:], &s); err != nil {
+		return err
+	}
+	fromProto(&s, c)
+	return nil
+}
+
+// DetectingStateCodec wraps a preferred StateCodec for Marshal, but sniffs the leading byte on Unmarshal
+// to decode a blob written by JSONStateCodec, GobStateCodec, or ProtoStateCodec, or an unprefixed legacy
+// JSON blob from before StateCodec existed. This lets an operator switch Preferred codecs without losing
+// the ability to decode workflows that are already running. Payloads written by CompressedStateCodec are
+// not recognized: their leading byte is a Compression value, not a codec magic byte.
+type DetectingStateCodec struct {
+	Preferred StateCodec
+}
+
+// Marshal implements StateCodec.
+func (d DetectingStateCodec) Marshal(c *EventCorrelator) ([]byte, error) {
+	return d.Preferred.Marshal(c)
+}
+
+// Unmarshal implements StateCodec.
+func (d DetectingStateCodec) Unmarshal(data []byte, c *EventCorrelator) error {
+	if len(data) == 0 {
+		return legacyJSONCodec.Unmarshal(data, c)
+	}
+	switch data[0] {
+	case magicJSON:
+		return JSONStateCodec{}.Unmarshal(data, c)
+	case magicGob:
+		return GobStateCodec{}.Unmarshal(data, c)
+	case magicProto:
+		return ProtoStateCodec{}.Unmarshal(data, c)
+	default:
+		// No recognized magic byte: assume a legacy, unprefixed JSON blob.
+		return legacyJSONCodec.Unmarshal(data, c)
+	}
+}
+
+// Compression is an algorithm CompressedStateCodec can wrap a StateCodec with.
+type Compression int
+
+const (
+	// CompressionGzip compresses with the standard library's compress/gzip.
+	CompressionGzip Compression = iota
+	// CompressionZstd compresses with github.com/klauspost/compress/zstd, which trades a larger
+	// dependency for a better compression ratio and faster decompression than gzip.
+	CompressionZstd
+)
+
+// CompressedStateCodec wraps another StateCodec, compressing what it marshals and decompressing before
+// handing bytes to it to unmarshal. Compressed payloads are prefixed with a byte identifying Compression,
+// ahead of whatever magic byte the wrapped codec itself writes.
+type CompressedStateCodec struct {
+	Inner       StateCodec
+	Compression Compression
+}
+
+// Marshal implements StateCodec.
+func (c CompressedStateCodec) Marshal(e *EventCorrelator) ([]byte, error) {
+	body, err := c.Inner.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := compress(c.Compression, body)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(c.Compression)}, compressed...), nil
+}
+
+// Unmarshal implements StateCodec.
+func (c CompressedStateCodec) Unmarshal(data []byte, e *EventCorrelator) error {
+	if len(data) == 0 {
+		return fmt.Errorf("fsm: empty CompressedStateCodec payload")
+	}
+	body, err := decompress(Compression(data[0]), data[1:])
+	if err != nil {
+		return err
+	}
+	return c.Inner.Unmarshal(body, e)
+}
+
+func compress(compression Compression, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch compression {
+	case CompressionGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("fsm: unknown Compression %d", compression)
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(compression Compression, body []byte) ([]byte, error) {
+	switch compression {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case CompressionZstd:
+		r, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("fsm: unknown Compression %d", compression)
+	}
+}
+
+func toProto(c *EventCorrelator) *statepb.State {
+	c.checkInit()
+	s := &statepb.State{
+		Activities:            make(map[string]*statepb.ActivityInfo, len(c.Activities)),
+		ActivityAttempts:      toInt64Map(c.ActivityAttempts),
+		ActivityFirstAttempts: toUnixMap(c.ActivityFirstAttempts),
+		Signals:               make(map[string]*statepb.SignalInfo, len(c.Signals)),
+		SignalAttempts:        toInt64Map(c.SignalAttempts),
+		SignalFirstAttempts:   toUnixMap(c.SignalFirstAttempts),
+		ChildWorkflows:        make(map[string]*statepb.ChildWorkflowInfo, len(c.ChildWorkflows)),
+		ChildWorkflowAttempts: toInt64Map(c.ChildWorkflowAttempts),
+		Timers:                make(map[string]*statepb.TimerInfo, len(c.Timers)),
+		ActivityRetryPolicies: toRetryPolicyMap(c.ActivityRetryPolicies),
+		SignalRetryPolicies:   toRetryPolicyMap(c.SignalRetryPolicies),
+	}
+	for k, v := range c.Activities {
+		pb := &statepb.ActivityInfo{ActivityID: v.ActivityID, Headers: v.Headers}
+		if v.ActivityType != nil {
+			pb.ActivityTypeName = stringValue(v.ActivityType.Name)
+			pb.ActivityTypeVersion = stringValue(v.ActivityType.Version)
+		}
+		s.Activities[k] = pb
+	}
+	for k, v := range c.Signals {
+		s.Signals[k] = &statepb.SignalInfo{SignalName: v.SignalName, WorkflowID: v.WorkflowID, Headers: v.Headers}
+	}
+	for k, v := range c.ChildWorkflows {
+		pb := &statepb.ChildWorkflowInfo{WorkflowID: v.WorkflowID, RunID: v.RunID, Headers: v.Headers}
+		if v.WorkflowType != nil {
+			pb.WorkflowTypeName = stringValue(v.WorkflowType.Name)
+			pb.WorkflowTypeVersion = stringValue(v.WorkflowType.Version)
+		}
+		s.ChildWorkflows[k] = pb
+	}
+	for k, v := range c.Timers {
+		s.Timers[k] = &statepb.TimerInfo{TimerID: v.TimerID}
+	}
+	return s
+}
+
+func fromProto(s *statepb.State, c *EventCorrelator) {
+	c.checkInit()
+	for k, v := range s.Activities {
+		c.Activities[k] = &ActivityInfo{
+			ActivityID:   v.ActivityID,
+			ActivityType: activityTypeFromProto(v),
+			Headers:      v.Headers,
+		}
+	}
+	c.ActivityAttempts = fromInt64Map(s.ActivityAttempts)
+	c.ActivityFirstAttempts = fromUnixMap(s.ActivityFirstAttempts)
+	for k, v := range s.Signals {
+		c.Signals[k] = &SignalInfo{SignalName: v.SignalName, WorkflowID: v.WorkflowID, Headers: v.Headers}
+	}
+	c.SignalAttempts = fromInt64Map(s.SignalAttempts)
+	c.SignalFirstAttempts = fromUnixMap(s.SignalFirstAttempts)
+	for k, v := range s.ChildWorkflows {
+		c.ChildWorkflows[k] = &ChildWorkflowInfo{
+			WorkflowID:   v.WorkflowID,
+			RunID:        v.RunID,
+			WorkflowType: workflowTypeFromProto(v),
+			Headers:      v.Headers,
+		}
+	}
+	c.ChildWorkflowAttempts = fromInt64Map(s.ChildWorkflowAttempts)
+	for k, v := range s.Timers {
+		c.Timers[k] = &TimerInfo{TimerID: v.TimerID}
+	}
+	c.ActivityRetryPolicies = fromRetryPolicyMap(s.ActivityRetryPolicies)
+	c.SignalRetryPolicies = fromRetryPolicyMap(s.SignalRetryPolicies)
+}
+
+func toRetryPolicyMap(m map[string]*RetryPolicy) map[string]*statepb.RetryPolicy {
+	out := make(map[string]*statepb.RetryPolicy, len(m))
+	for k, p := range m {
+		out[k] = &statepb.RetryPolicy{
+			InitialIntervalNanos:    int64(p.InitialInterval),
+			BackoffCoefficient:      p.BackoffCoefficient,
+			MaximumIntervalNanos:    int64(p.MaximumInterval),
+			MaximumAttempts:         int64(p.MaximumAttempts),
+			ExpirationIntervalNanos: int64(p.ExpirationInterval),
+			NonRetriableErrorTypes:  p.NonRetriableErrorTypes,
+		}
+	}
+	return out
+}
+
+func fromRetryPolicyMap(m map[string]*statepb.RetryPolicy) map[string]*RetryPolicy {
+	out := make(map[string]*RetryPolicy, len(m))
+	for k, p := range m {
+		out[k] = &RetryPolicy{
+			InitialInterval:        time.Duration(p.InitialIntervalNanos),
+			BackoffCoefficient:     p.BackoffCoefficient,
+			MaximumInterval:        time.Duration(p.MaximumIntervalNanos),
+			MaximumAttempts:        int(p.MaximumAttempts),
+			ExpirationInterval:     time.Duration(p.ExpirationIntervalNanos),
+			NonRetriableErrorTypes: p.NonRetriableErrorTypes,
+		}
+	}
+	return out
+}
+
+func toInt64Map(m map[string]int) map[string]int64 {
+	out := make(map[string]int64, len(m))
+	for k, v := range m {
+		out[k] = int64(v)
+	}
+	return out
+}
+
+func fromInt64Map(m map[string]int64) map[string]int {
+	out := make(map[string]int, len(m))
+	for k, v := range m {
+		out[k] = int(v)
+	}
+	return out
+}
+
+func toUnixMap(m map[string]time.Time) map[string]int64 {
+	out := make(map[string]int64, len(m))
+	for k, v := range m {
+		out[k] = v.Unix()
+	}
+	return out
+}
+
+func fromUnixMap(m map[string]int64) map[string]time.Time {
+	out := make(map[string]time.Time, len(m))
+	for k, v := range m {
+		out[k] = time.Unix(v, 0)
+	}
+	return out
+}
+
+func activityTypeFromProto(v *statepb.ActivityInfo) *swf.ActivityType {
+	if v.ActivityTypeName == "" && v.ActivityTypeVersion == "" {
+		return nil
+	}
+	return &swf.ActivityType{Name: aws.String(v.ActivityTypeName), Version: aws.String(v.ActivityTypeVersion)}
+}
+
+func workflowTypeFromProto(v *statepb.ChildWorkflowInfo) *swf.WorkflowType {
+	if v.WorkflowTypeName == "" && v.WorkflowTypeVersion == "" {
+		return nil
+	}
+	return &swf.WorkflowType{Name: aws.String(v.WorkflowTypeName), Version: aws.String(v.WorkflowTypeVersion)}
+}
@@ -0,0 +1,197 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+func TestJSONStateCodecRoundTrip(t *testing.T) {
+	c := &EventCorrelator{}
+	c.checkInit()
+	c.Activities["1"] = &ActivityInfo{ActivityID: "a1", ActivityType: &swf.ActivityType{Name: aws.String("widgetify")}}
+
+	data, err := JSONStateCodec{}.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got EventCorrelator
+	if err := (JSONStateCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Activities["1"].ActivityID != "a1" {
+		t.Fatalf("got ActivityID %q, want a1", got.Activities["1"].ActivityID)
+	}
+}
+
+func TestJSONStateCodecUnmarshalsLegacyUnprefixedPayload(t *testing.T) {
+	legacy := []byte(`{"Activities":{"1":{"ActivityID":"a1"}}}`)
+
+	var got EventCorrelator
+	if err := (JSONStateCodec{}).Unmarshal(legacy, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Activities["1"].ActivityID != "a1" {
+		t.Fatalf("got ActivityID %q, want a1", got.Activities["1"].ActivityID)
+	}
+}
+
+// TestGobStateCodecRoundTripWithHeaderCodec exercises the case that used to make GobStateCodec.Marshal
+// fail outright: a correlator with a non-nil HeaderCodec set, which gob can't encode without a
+// gob.Register'd concrete type behind the interface.
+func TestGobStateCodecRoundTripWithHeaderCodec(t *testing.T) {
+	c := &EventCorrelator{HeaderCodec: JSONHeaderCodec{}}
+	c.checkInit()
+	c.Activities["1"] = &ActivityInfo{ActivityID: "a1", ActivityType: &swf.ActivityType{Name: aws.String("widgetify")}}
+	c.ActivityAttempts["a1"] = 2
+	c.ActivityFirstAttempts["a1"] = time.Unix(1000, 0)
+
+	data, err := GobStateCodec{}.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got EventCorrelator
+	if err := (GobStateCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Activities["1"].ActivityID != "a1" {
+		t.Fatalf("got ActivityID %q, want a1", got.Activities["1"].ActivityID)
+	}
+	if got.ActivityAttempts["a1"] != 2 {
+		t.Fatalf("got ActivityAttempts[a1] = %d, want 2", got.ActivityAttempts["a1"])
+	}
+	if got.HeaderCodec != nil {
+		t.Fatal("HeaderCodec is runtime config, not serialized state; expected it to stay nil across Gob Unmarshal")
+	}
+}
+
+func TestGobStateCodecUnmarshalRejectsWrongMagicByte(t *testing.T) {
+	var got EventCorrelator
+	if err := (GobStateCodec{}).Unmarshal([]byte{magicJSON}, &got); err == nil {
+		t.Fatal("expected an error unmarshaling a non-Gob payload")
+	}
+}
+
+// TestProtoStateCodecRoundTripsRetryPolicies guards against ProtoStateCodec silently dropping
+// ActivityRetryPolicies/SignalRetryPolicies, which toProto/fromProto used to never touch at all.
+func TestProtoStateCodecRoundTripsRetryPolicies(t *testing.T) {
+	c := &EventCorrelator{}
+	c.AddActivityRetryPolicy("widgetify", &RetryPolicy{
+		InitialInterval:        time.Second,
+		BackoffCoefficient:     2.0,
+		MaximumInterval:        time.Minute,
+		MaximumAttempts:        5,
+		ExpirationInterval:     time.Hour,
+		NonRetriableErrorTypes: []string{"FatalError"},
+	})
+	c.AddSignalRetryPolicy("proceed", &RetryPolicy{
+		InitialInterval:    500 * time.Millisecond,
+		BackoffCoefficient: 1.5,
+	})
+
+	data, err := ProtoStateCodec{}.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got EventCorrelator
+	if err := (ProtoStateCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	activityPolicy := got.RetryPolicyForActivity("widgetify")
+	if activityPolicy == nil {
+		t.Fatal("expected an activity RetryPolicy to survive the round trip")
+	}
+	if activityPolicy.InitialInterval != time.Second ||
+		activityPolicy.BackoffCoefficient != 2.0 ||
+		activityPolicy.MaximumInterval != time.Minute ||
+		activityPolicy.MaximumAttempts != 5 ||
+		activityPolicy.ExpirationInterval != time.Hour ||
+		len(activityPolicy.NonRetriableErrorTypes) != 1 ||
+		activityPolicy.NonRetriableErrorTypes[0] != "FatalError" {
+		t.Fatalf("got activity RetryPolicy %+v, want the original fields back", activityPolicy)
+	}
+
+	signalPolicy := got.RetryPolicyForSignal("proceed")
+	if signalPolicy == nil {
+		t.Fatal("expected a signal RetryPolicy to survive the round trip")
+	}
+	if signalPolicy.InitialInterval != 500*time.Millisecond || signalPolicy.BackoffCoefficient != 1.5 {
+		t.Fatalf("got signal RetryPolicy %+v, want the original fields back", signalPolicy)
+	}
+}
+
+func TestDetectingStateCodecUnmarshalsEachWrappedCodec(t *testing.T) {
+	c := &EventCorrelator{}
+	c.checkInit()
+	c.Activities["1"] = &ActivityInfo{ActivityID: "a1", ActivityType: &swf.ActivityType{Name: aws.String("widgetify")}}
+
+	for _, preferred := range []StateCodec{JSONStateCodec{}, GobStateCodec{}, ProtoStateCodec{}} {
+		data, err := preferred.Marshal(c)
+		if err != nil {
+			t.Fatalf("%T Marshal: %v", preferred, err)
+		}
+
+		var got EventCorrelator
+		if err := (DetectingStateCodec{}).Unmarshal(data, &got); err != nil {
+			t.Fatalf("DetectingStateCodec.Unmarshal of a %T payload: %v", preferred, err)
+		}
+		if got.Activities["1"].ActivityID != "a1" {
+			t.Fatalf("%T: got ActivityID %q, want a1", preferred, got.Activities["1"].ActivityID)
+		}
+	}
+}
+
+func TestDetectingStateCodecUnmarshalsLegacyUnprefixedPayload(t *testing.T) {
+	legacy := []byte(`{"Activities":{"1":{"ActivityID":"a1"}}}`)
+
+	var got EventCorrelator
+	if err := (DetectingStateCodec{}).Unmarshal(legacy, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Activities["1"].ActivityID != "a1" {
+		t.Fatalf("got ActivityID %q, want a1", got.Activities["1"].ActivityID)
+	}
+}
+
+func TestDetectingStateCodecMarshalUsesPreferred(t *testing.T) {
+	c := &EventCorrelator{}
+	c.checkInit()
+	c.Activities["1"] = &ActivityInfo{ActivityID: "a1"}
+
+	d := DetectingStateCodec{Preferred: GobStateCodec{}}
+	data, err := d.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if len(data) == 0 || data[0] != magicGob {
+		t.Fatalf("expected DetectingStateCodec.Marshal to defer to Preferred (GobStateCodec), got leading byte %v", data[:1])
+	}
+}
+
+func TestCompressedStateCodecRoundTrip(t *testing.T) {
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd} {
+		c := &EventCorrelator{}
+		c.checkInit()
+		c.Activities["1"] = &ActivityInfo{ActivityID: "a1", ActivityType: &swf.ActivityType{Name: aws.String("widgetify")}}
+
+		codec := CompressedStateCodec{Inner: JSONStateCodec{}, Compression: compression}
+		data, err := codec.Marshal(c)
+		if err != nil {
+			t.Fatalf("compression %d Marshal: %v", compression, err)
+		}
+
+		var got EventCorrelator
+		if err := codec.Unmarshal(data, &got); err != nil {
+			t.Fatalf("compression %d Unmarshal: %v", compression, err)
+		}
+		if got.Activities["1"].ActivityID != "a1" {
+			t.Fatalf("compression %d: got ActivityID %q, want a1", compression, got.Activities["1"].ActivityID)
+		}
+	}
+}
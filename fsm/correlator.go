@@ -3,6 +3,7 @@ package fsm
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/awslabs/aws-sdk-go/aws"
 	"github.com/awslabs/aws-sdk-go/gen/swf"
@@ -13,22 +14,46 @@ import (
 // end of an activity or signal  hits your Decider.  This is missing from the SWF api.
 // Activities and Signals are string instead of int64 beacuse json.
 type EventCorrelator struct {
-	Activities       map[string]*ActivityInfo //schedueledEventId -> info
-	ActivityAttempts map[string]int           //activityID -> attempts
-	Signals          map[string]*SignalInfo   //schedueledEventId -> info
-	SignalAttempts   map[string]int           //? workflowID + signalName -> attempts
+	Activities            map[string]*ActivityInfo      //schedueledEventId -> info
+	ActivityAttempts      map[string]int                //activityID -> attempts
+	ActivityFirstAttempts map[string]time.Time          //activityID -> time of first scheduling
+	ActivityRetryPolicies map[string]*RetryPolicy       //activityType name -> retry policy
+	Signals               map[string]*SignalInfo        //schedueledEventId -> info
+	SignalAttempts        map[string]int                //? workflowID + signalName -> attempts
+	SignalFirstAttempts   map[string]time.Time          //signalID -> time of first scheduling
+	SignalRetryPolicies   map[string]*RetryPolicy       //signal name -> retry policy
+	ChildWorkflows        map[string]*ChildWorkflowInfo //initiatedEventId -> info
+	ChildWorkflowAttempts map[string]int                //workflowID -> attempts
+	Timers                map[string]*TimerInfo         //startedEventId -> info
+	HeaderCodec           HeaderCodec                   `json:"-"` //optional, used to split headers out of Input on Correlate; runtime config, not serialized state
 }
 
 // ActivityInfo holds the ActivityID and ActivityType for an activity
 type ActivityInfo struct {
 	ActivityID string
 	*swf.ActivityType
+	Headers map[string][]byte
 }
 
 // SignalInfo holds the SignalName and Input for an activity
 type SignalInfo struct {
 	SignalName string
 	WorkflowID string
+	Headers    map[string][]byte
+}
+
+// ChildWorkflowInfo holds the WorkflowID, RunID, and WorkflowType for a child workflow execution.
+// RunID is empty until the corresponding ChildWorkflowExecutionStarted event is seen.
+type ChildWorkflowInfo struct {
+	WorkflowID string
+	RunID      string
+	*swf.WorkflowType
+	Headers map[string][]byte
+}
+
+// TimerInfo holds the TimerID for a timer started by the workflow.
+type TimerInfo struct {
+	TimerID string
 }
 
 // Track will add or remove entries based on the EventType.
@@ -43,19 +68,50 @@ func (a *EventCorrelator) Correlate(h swf.HistoryEvent) {
 	a.checkInit()
 
 	if *h.EventType == swf.EventTypeActivityTaskScheduled {
+		attrs := h.ActivityTaskScheduledEventAttributes
+		activityID := *attrs.ActivityID
 		a.Activities[a.key(h.EventID)] = &ActivityInfo{
-			ActivityID:   *h.ActivityTaskScheduledEventAttributes.ActivityID,
-			ActivityType: h.ActivityTaskScheduledEventAttributes.ActivityType,
+			ActivityID:   activityID,
+			ActivityType: attrs.ActivityType,
+			Headers:      a.decodeHeaders(attrs.Input),
 		}
+		a.recordFirstAttempt(a.ActivityFirstAttempts, activityID, h)
 	}
 
 	if *h.EventType == swf.EventTypeSignalExternalWorkflowExecutionInitiated {
-		a.Signals[a.key(h.EventID)] = &SignalInfo{
-			SignalName: *h.SignalExternalWorkflowExecutionInitiatedEventAttributes.SignalName,
-			WorkflowID: *h.SignalExternalWorkflowExecutionInitiatedEventAttributes.WorkflowID,
+		attrs := h.SignalExternalWorkflowExecutionInitiatedEventAttributes
+		info := &SignalInfo{
+			SignalName: *attrs.SignalName,
+			WorkflowID: *attrs.WorkflowID,
+			Headers:    a.decodeHeaders(attrs.Input),
 		}
+		a.Signals[a.key(h.EventID)] = info
+		a.recordFirstAttempt(a.SignalFirstAttempts, a.signalIDFromInfo(info), h)
 		fmt.Printf("added signal @ %s\n %+v\n", a.key(h.EventID), a.Signals)
 	}
+
+	if *h.EventType == swf.EventTypeStartChildWorkflowExecutionInitiated {
+		attrs := h.StartChildWorkflowExecutionInitiatedEventAttributes
+		a.ChildWorkflows[a.key(h.EventID)] = &ChildWorkflowInfo{
+			WorkflowID:   *attrs.WorkflowID,
+			WorkflowType: attrs.WorkflowType,
+			Headers:      a.decodeHeaders(attrs.Input),
+		}
+	}
+
+	if *h.EventType == swf.EventTypeChildWorkflowExecutionStarted {
+		attrs := h.ChildWorkflowExecutionStartedEventAttributes
+		if info := a.ChildWorkflows[a.key(attrs.InitiatedEventID)]; info != nil {
+			info.RunID = *attrs.WorkflowExecution.RunID
+		}
+	}
+
+	if *h.EventType == swf.EventTypeTimerStarted {
+		attrs := h.TimerStartedEventAttributes
+		a.Timers[a.key(h.EventID)] = &TimerInfo{
+			TimerID: *attrs.TimerID,
+		}
+	}
 }
 
 // RemoveCorrelation gcs a mapping of eventId to ActivityType. The HistoryEvent is expected to be of type EventTypeActivityTaskCompleted,EventTypeActivityTaskFailed,EventTypeActivityTaskTimedOut.
@@ -64,6 +120,7 @@ func (a *EventCorrelator) RemoveCorrelation(h swf.HistoryEvent) {
 
 	switch *h.EventType {
 	case swf.EventTypeActivityTaskCompleted:
+		delete(a.ActivityFirstAttempts, a.safeActivityID(h))
 		delete(a.ActivityAttempts, a.safeActivityID(h))
 		delete(a.Activities, a.key(h.ActivityTaskCompletedEventAttributes.ScheduledEventID))
 	case swf.EventTypeActivityTaskFailed:
@@ -73,15 +130,36 @@ func (a *EventCorrelator) RemoveCorrelation(h swf.HistoryEvent) {
 		a.incrementActivityAttempts(h)
 		delete(a.Activities, a.key(h.ActivityTaskTimedOutEventAttributes.ScheduledEventID))
 	case swf.EventTypeActivityTaskCanceled:
+		delete(a.ActivityFirstAttempts, a.safeActivityID(h))
 		delete(a.ActivityAttempts, a.safeActivityID(h))
 		delete(a.Activities, a.key(h.ActivityTaskCanceledEventAttributes.ScheduledEventID))
 	case swf.EventTypeExternalWorkflowExecutionSignaled:
 		info := a.Signals[a.key(h.ExternalWorkflowExecutionSignaledEventAttributes.InitiatedEventID)]
+		delete(a.SignalFirstAttempts, a.signalIDFromInfo(info))
 		delete(a.SignalAttempts, a.signalIDFromInfo(info))
 		delete(a.Signals, a.key(h.ExternalWorkflowExecutionSignaledEventAttributes.InitiatedEventID))
 	case swf.EventTypeSignalExternalWorkflowExecutionFailed:
 		a.incrementSignalAttempts(h)
 		delete(a.Signals, a.key(h.SignalExternalWorkflowExecutionFailedEventAttributes.InitiatedEventID))
+	case swf.EventTypeChildWorkflowExecutionCompleted:
+		delete(a.ChildWorkflowAttempts, a.safeChildWorkflowID(h))
+		delete(a.ChildWorkflows, a.key(h.ChildWorkflowExecutionCompletedEventAttributes.InitiatedEventID))
+	case swf.EventTypeChildWorkflowExecutionFailed:
+		a.incrementChildWorkflowAttempts(h)
+		delete(a.ChildWorkflows, a.key(h.ChildWorkflowExecutionFailedEventAttributes.InitiatedEventID))
+	case swf.EventTypeChildWorkflowExecutionTimedOut:
+		a.incrementChildWorkflowAttempts(h)
+		delete(a.ChildWorkflows, a.key(h.ChildWorkflowExecutionTimedOutEventAttributes.InitiatedEventID))
+	case swf.EventTypeChildWorkflowExecutionTerminated:
+		delete(a.ChildWorkflowAttempts, a.safeChildWorkflowID(h))
+		delete(a.ChildWorkflows, a.key(h.ChildWorkflowExecutionTerminatedEventAttributes.InitiatedEventID))
+	case swf.EventTypeChildWorkflowExecutionCanceled:
+		delete(a.ChildWorkflowAttempts, a.safeChildWorkflowID(h))
+		delete(a.ChildWorkflows, a.key(h.ChildWorkflowExecutionCanceledEventAttributes.InitiatedEventID))
+	case swf.EventTypeTimerFired:
+		delete(a.Timers, a.key(h.TimerFiredEventAttributes.StartedEventID))
+	case swf.EventTypeTimerCanceled:
+		delete(a.Timers, a.key(h.TimerCanceledEventAttributes.StartedEventID))
 	}
 }
 
@@ -97,6 +175,39 @@ func (a *EventCorrelator) SignalInfo(h swf.HistoryEvent) *SignalInfo {
 	return a.Signals[a.getID(h)]
 }
 
+// ChildWorkflowInfo returns the ChildWorkflowInfo that correlates with a given event. The HistoryEvent is
+// expected to be of type EventTypeChildWorkflowExecutionStarted,EventTypeChildWorkflowExecutionCompleted,
+// EventTypeChildWorkflowExecutionFailed,EventTypeChildWorkflowExecutionTimedOut,
+// EventTypeChildWorkflowExecutionTerminated,EventTypeChildWorkflowExecutionCanceled.
+func (a *EventCorrelator) ChildWorkflowInfo(h swf.HistoryEvent) *ChildWorkflowInfo {
+	a.checkInit()
+	return a.ChildWorkflows[a.getID(h)]
+}
+
+// TimerInfo returns the TimerInfo that correlates with a given event. The HistoryEvent is expected to be
+// of type EventTypeTimerFired,EventTypeTimerCanceled.
+func (a *EventCorrelator) TimerInfo(h swf.HistoryEvent) *TimerInfo {
+	a.checkInit()
+	return a.Timers[a.getID(h)]
+}
+
+// CorrelatorHeaders returns the headers that were present on the Input of the activity, signal, or
+// child workflow that h correlates with, e.g. a tracing span context or tenant id set when it was
+// scheduled several decision tasks ago. It returns nil if h doesn't correlate to anything tracked, or
+// no headers were present.
+func (a *EventCorrelator) CorrelatorHeaders(h swf.HistoryEvent) map[string][]byte {
+	if info := a.ActivityInfo(h); info != nil {
+		return info.Headers
+	}
+	if info := a.SignalInfo(h); info != nil {
+		return info.Headers
+	}
+	if info := a.ChildWorkflowInfo(h); info != nil {
+		return info.Headers
+	}
+	return nil
+}
+
 //AttemptsForActivity returns the number of times a given activity has been attempted.
 //It will return 0 if the activity has never failed, has been canceled, or has been completed successfully
 func (a *EventCorrelator) AttemptsForActivity(info *ActivityInfo) int {
@@ -111,6 +222,13 @@ func (a *EventCorrelator) AttemptsForSignal(signalInfo *SignalInfo) int {
 	return a.SignalAttempts[a.signalIDFromInfo(signalInfo)]
 }
 
+//AttemptsForChildWorkflow returns the number of times a given child workflow has been attempted.
+//It will return 0 if the child workflow has never failed or timed out, or has completed successfully
+func (a *EventCorrelator) AttemptsForChildWorkflow(info *ChildWorkflowInfo) int {
+	a.checkInit()
+	return a.ChildWorkflowAttempts[info.WorkflowID]
+}
+
 func (a *EventCorrelator) checkInit() {
 	if a.Activities == nil {
 		a.Activities = make(map[string]*ActivityInfo)
@@ -118,12 +236,56 @@ func (a *EventCorrelator) checkInit() {
 	if a.ActivityAttempts == nil {
 		a.ActivityAttempts = make(map[string]int)
 	}
+	if a.ActivityFirstAttempts == nil {
+		a.ActivityFirstAttempts = make(map[string]time.Time)
+	}
 	if a.Signals == nil {
 		a.Signals = make(map[string]*SignalInfo)
 	}
 	if a.SignalAttempts == nil {
 		a.SignalAttempts = make(map[string]int)
 	}
+	if a.SignalFirstAttempts == nil {
+		a.SignalFirstAttempts = make(map[string]time.Time)
+	}
+	if a.ChildWorkflows == nil {
+		a.ChildWorkflows = make(map[string]*ChildWorkflowInfo)
+	}
+	if a.ChildWorkflowAttempts == nil {
+		a.ChildWorkflowAttempts = make(map[string]int)
+	}
+	if a.Timers == nil {
+		a.Timers = make(map[string]*TimerInfo)
+	}
+}
+
+// recordFirstAttempt notes the time an activity or signal was first scheduled, if it hasn't been already.
+// Later retries reuse the same id, so this timestamp anchors an ExpirationInterval across the whole retry sequence.
+func (a *EventCorrelator) recordFirstAttempt(attempts map[string]time.Time, id string, h swf.HistoryEvent) {
+	if _, ok := attempts[id]; ok {
+		return
+	}
+	attempts[id] = eventTime(h)
+}
+
+// eventTime returns the wall-clock time SWF recorded a HistoryEvent at, falling back to time.Now() only
+// for the malformed case where EventTimestamp is missing. Deciders must replay deterministically, so any
+// logic that needs "now" while reacting to a HistoryEvent (e.g. checking a RetryPolicy's
+// ExpirationInterval) should derive it from the triggering event's EventTimestamp rather than calling
+// time.Now() directly.
+func eventTime(h swf.HistoryEvent) time.Time {
+	if h.EventTimestamp != nil {
+		return time.Unix(int64(*h.EventTimestamp), 0)
+	}
+	return time.Now()
+}
+
+func (a *EventCorrelator) decodeHeaders(input *string) map[string][]byte {
+	if a.HeaderCodec == nil || input == nil {
+		return nil
+	}
+	_, headers := a.HeaderCodec.Decode(*input)
+	return headers
 }
 
 func (a *EventCorrelator) getID(h swf.HistoryEvent) (id string) {
@@ -140,6 +302,22 @@ func (a *EventCorrelator) getID(h swf.HistoryEvent) (id string) {
 		id = a.key(h.ExternalWorkflowExecutionSignaledEventAttributes.InitiatedEventID)
 	case swf.EventTypeSignalExternalWorkflowExecutionFailed:
 		id = a.key(h.SignalExternalWorkflowExecutionFailedEventAttributes.InitiatedEventID)
+	case swf.EventTypeChildWorkflowExecutionStarted:
+		id = a.key(h.ChildWorkflowExecutionStartedEventAttributes.InitiatedEventID)
+	case swf.EventTypeChildWorkflowExecutionCompleted:
+		id = a.key(h.ChildWorkflowExecutionCompletedEventAttributes.InitiatedEventID)
+	case swf.EventTypeChildWorkflowExecutionFailed:
+		id = a.key(h.ChildWorkflowExecutionFailedEventAttributes.InitiatedEventID)
+	case swf.EventTypeChildWorkflowExecutionTimedOut:
+		id = a.key(h.ChildWorkflowExecutionTimedOutEventAttributes.InitiatedEventID)
+	case swf.EventTypeChildWorkflowExecutionTerminated:
+		id = a.key(h.ChildWorkflowExecutionTerminatedEventAttributes.InitiatedEventID)
+	case swf.EventTypeChildWorkflowExecutionCanceled:
+		id = a.key(h.ChildWorkflowExecutionCanceledEventAttributes.InitiatedEventID)
+	case swf.EventTypeTimerFired:
+		id = a.key(h.TimerFiredEventAttributes.StartedEventID)
+	case swf.EventTypeTimerCanceled:
+		id = a.key(h.TimerCanceledEventAttributes.StartedEventID)
 	}
 	return
 }
@@ -164,6 +342,14 @@ func (a *EventCorrelator) signalIDFromInfo(info *SignalInfo) string {
 	return fmt.Sprintf("%s->%s", info.SignalName, info.WorkflowID)
 }
 
+func (a *EventCorrelator) safeChildWorkflowID(h swf.HistoryEvent) string {
+	info := a.ChildWorkflows[a.getID(h)]
+	if info != nil {
+		return info.WorkflowID
+	}
+	return ""
+}
+
 func (a *EventCorrelator) incrementActivityAttempts(h swf.HistoryEvent) {
 	id := a.safeActivityID(h)
 	if id != "" {
@@ -178,6 +364,13 @@ func (a *EventCorrelator) incrementSignalAttempts(h swf.HistoryEvent) {
 	}
 }
 
+func (a *EventCorrelator) incrementChildWorkflowAttempts(h swf.HistoryEvent) {
+	id := a.safeChildWorkflowID(h)
+	if id != "" {
+		a.ChildWorkflowAttempts[id]++
+	}
+}
+
 func (a *EventCorrelator) key(eventID aws.LongValue) string {
 	return strconv.FormatInt(*eventID, 10)
 }
@@ -0,0 +1,119 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+func eventID(id int64) aws.LongValue {
+	return &id
+}
+
+func TestCorrelatorTracksChildWorkflow(t *testing.T) {
+	c := &EventCorrelator{}
+
+	initiated := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeStartChildWorkflowExecutionInitiated),
+		EventID:   eventID(1),
+		StartChildWorkflowExecutionInitiatedEventAttributes: &swf.StartChildWorkflowExecutionInitiatedEventAttributes{
+			WorkflowID:   aws.String("child-1"),
+			WorkflowType: &swf.WorkflowType{Name: aws.String("child-workflow"), Version: aws.String("1.0")},
+		},
+	}
+	c.Track(initiated)
+
+	info := c.ChildWorkflows["1"]
+	if info == nil {
+		t.Fatal("expected a tracked ChildWorkflowInfo after StartChildWorkflowExecutionInitiated")
+	}
+	if info.WorkflowID != "child-1" {
+		t.Fatalf("got WorkflowID %q, want child-1", info.WorkflowID)
+	}
+	if info.RunID != "" {
+		t.Fatalf("got RunID %q, want empty until ChildWorkflowExecutionStarted", info.RunID)
+	}
+
+	started := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeChildWorkflowExecutionStarted),
+		ChildWorkflowExecutionStartedEventAttributes: &swf.ChildWorkflowExecutionStartedEventAttributes{
+			InitiatedEventID:  eventID(1),
+			WorkflowExecution: &swf.WorkflowExecution{RunID: aws.String("run-1")},
+		},
+	}
+	c.Track(started)
+	if info.RunID != "run-1" {
+		t.Fatalf("got RunID %q, want run-1 after ChildWorkflowExecutionStarted", info.RunID)
+	}
+
+	completed := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeChildWorkflowExecutionCompleted),
+		ChildWorkflowExecutionCompletedEventAttributes: &swf.ChildWorkflowExecutionCompletedEventAttributes{
+			InitiatedEventID: eventID(1),
+		},
+	}
+	c.Track(completed)
+	if c.ChildWorkflows["1"] != nil {
+		t.Fatal("expected ChildWorkflowExecutionCompleted to remove the correlation")
+	}
+}
+
+func TestCorrelatorTracksChildWorkflowFailureIncrementsAttempts(t *testing.T) {
+	c := &EventCorrelator{}
+	initiated := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeStartChildWorkflowExecutionInitiated),
+		EventID:   eventID(1),
+		StartChildWorkflowExecutionInitiatedEventAttributes: &swf.StartChildWorkflowExecutionInitiatedEventAttributes{
+			WorkflowID:   aws.String("child-1"),
+			WorkflowType: &swf.WorkflowType{Name: aws.String("child-workflow"), Version: aws.String("1.0")},
+		},
+	}
+	c.Track(initiated)
+
+	failed := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeChildWorkflowExecutionFailed),
+		ChildWorkflowExecutionFailedEventAttributes: &swf.ChildWorkflowExecutionFailedEventAttributes{
+			InitiatedEventID: eventID(1),
+		},
+	}
+	c.Track(failed)
+
+	if got := c.AttemptsForChildWorkflow(&ChildWorkflowInfo{WorkflowID: "child-1"}); got != 1 {
+		t.Fatalf("got %d attempts, want 1 after ChildWorkflowExecutionFailed", got)
+	}
+}
+
+func TestCorrelatorTracksTimer(t *testing.T) {
+	c := &EventCorrelator{}
+
+	started := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeTimerStarted),
+		EventID:   eventID(1),
+		TimerStartedEventAttributes: &swf.TimerStartedEventAttributes{
+			TimerID: aws.String("retry->a1"),
+		},
+	}
+	c.Track(started)
+
+	info := c.Timers["1"]
+	if info == nil || info.TimerID != "retry->a1" {
+		t.Fatalf("got Timers[1] = %+v, want TimerID retry->a1", info)
+	}
+
+	fired := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeTimerFired),
+		TimerFiredEventAttributes: &swf.TimerFiredEventAttributes{
+			StartedEventID: eventID(1),
+		},
+	}
+	gotInfo := c.TimerInfo(fired)
+	if gotInfo == nil || gotInfo.TimerID != "retry->a1" {
+		t.Fatalf("TimerInfo(fired) = %+v, want TimerID retry->a1", gotInfo)
+	}
+
+	c.Track(fired)
+	if c.Timers["1"] != nil {
+		t.Fatal("expected TimerFired to remove the correlation")
+	}
+}
@@ -0,0 +1,40 @@
+package fsm
+
+import (
+	"context"
+
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+// FSM is the per-workflow-type decider configuration. It holds the Interceptors that wrap dispatch of a
+// decision task and every correlator mutation it makes; the EventCorrelator itself is passed in by the
+// caller of track and decide.
+type FSM struct {
+	Interceptors []Interceptor
+	HeaderCodec  HeaderCodec
+}
+
+// track folds h into correlator by calling correlator.Track, wrapped in f.Interceptors so each one gets a
+// chance to run code before and after the mutation, or recover a panic from it, not just observe events
+// that reach a Decider. It first copies f.HeaderCodec onto correlator if the correlator doesn't already
+// have one of its own, so a caller who sets FSM.HeaderCodec gets CorrelatorHeaders/ActivityInfo.Headers/
+// etc. populated without also having to set EventCorrelator.HeaderCodec by hand.
+func (f *FSM) track(correlator *EventCorrelator, h swf.HistoryEvent) {
+	if correlator.HeaderCodec == nil {
+		correlator.HeaderCodec = f.HeaderCodec
+	}
+	chain := composeTrackInterceptors(f.Interceptors, func(h swf.HistoryEvent, correlator *EventCorrelator) {
+		correlator.Track(h)
+	})
+	chain(h, correlator)
+}
+
+// decide dispatches a single decision task by calling decide, wrapped in f.Interceptors so each one gets
+// a chance to add metrics, tracing, panic recovery, or payload redaction around the real Decider
+// invocation without forking the decider loop itself.
+func (f *FSM) decide(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator, decide func() ([]swf.Decision, error)) ([]swf.Decision, error) {
+	chain := composeInterceptors(f.Interceptors, func(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator) ([]swf.Decision, error) {
+		return decide()
+	})
+	return chain(ctx, task, correlator)
+}
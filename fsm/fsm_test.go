@@ -0,0 +1,109 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+func TestFSMTrackRunsThroughInterceptorChain(t *testing.T) {
+	var order []string
+	f := &FSM{Interceptors: []Interceptor{orderInterceptor{name: "outer", order: &order}}}
+	correlator := &EventCorrelator{}
+
+	f.track(correlator, swf.HistoryEvent{EventType: aws.String(swf.EventTypeWorkflowExecutionStarted)})
+
+	want := []string{"before:outer", "after:outer"}
+	assertOrder(t, order, want)
+}
+
+func TestFSMTrackFoldsEventIntoCorrelator(t *testing.T) {
+	f := &FSM{}
+	correlator := &EventCorrelator{}
+
+	f.track(correlator, swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeActivityTaskScheduled),
+		EventID:   eventID(42),
+		ActivityTaskScheduledEventAttributes: &swf.ActivityTaskScheduledEventAttributes{
+			ActivityID: aws.String("a1"),
+		},
+	})
+
+	if correlator.Activities["42"] == nil || correlator.Activities["42"].ActivityID != "a1" {
+		t.Fatalf("expected f.track to have called correlator.Track, got %+v", correlator.Activities)
+	}
+}
+
+func TestFSMTrackWiresHeaderCodecIntoCorrelator(t *testing.T) {
+	f := &FSM{HeaderCodec: JSONHeaderCodec{}}
+	correlator := &EventCorrelator{}
+	input := JSONHeaderCodec{}.Encode("the input", map[string][]byte{"trace-id": []byte("abc123")})
+
+	event := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeActivityTaskScheduled),
+		EventID:   eventID(42),
+		ActivityTaskScheduledEventAttributes: &swf.ActivityTaskScheduledEventAttributes{
+			ActivityID: aws.String("a1"),
+			Input:      aws.String(input),
+		},
+	}
+	f.track(correlator, event)
+
+	completed := swf.HistoryEvent{
+		EventType: aws.String(swf.EventTypeActivityTaskCompleted),
+		ActivityTaskCompletedEventAttributes: &swf.ActivityTaskCompletedEventAttributes{
+			ScheduledEventID: eventID(42),
+		},
+	}
+	headers := correlator.CorrelatorHeaders(completed)
+	if string(headers["trace-id"]) != "abc123" {
+		t.Fatalf("got headers %v, want trace-id=abc123; FSM.HeaderCodec was never copied onto the correlator", headers)
+	}
+}
+
+func TestFSMTrackDoesNotOverrideCorrelatorsOwnHeaderCodec(t *testing.T) {
+	f := &FSM{HeaderCodec: &JSONHeaderCodec{}}
+	correlatorCodec := JSONHeaderCodec{}
+	correlator := &EventCorrelator{HeaderCodec: correlatorCodec}
+
+	f.track(correlator, swf.HistoryEvent{EventType: aws.String(swf.EventTypeWorkflowExecutionStarted)})
+
+	if correlator.HeaderCodec != correlatorCodec {
+		t.Fatal("expected f.track to leave an already-set EventCorrelator.HeaderCodec alone")
+	}
+}
+
+func TestFSMDecideRunsThroughInterceptorChain(t *testing.T) {
+	var order []string
+	f := &FSM{Interceptors: []Interceptor{orderInterceptor{name: "outer", order: &order}}}
+	correlator := &EventCorrelator{}
+
+	decisions, err := f.decide(context.Background(), &swf.PollForDecisionTaskOutput{}, correlator, func() ([]swf.Decision, error) {
+		order = append(order, "real")
+		return []swf.Decision{{DecisionType: aws.String(swf.DecisionTypeCompleteWorkflowExecution)}}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decisions) != 1 {
+		t.Fatalf("got %d decisions, want 1", len(decisions))
+	}
+
+	want := []string{"before:outer", "real", "after:outer"}
+	assertOrder(t, order, want)
+}
+
+func TestFSMDecidePropagatesRealError(t *testing.T) {
+	f := &FSM{}
+	wantErr := fmt.Errorf("decision failed")
+
+	_, err := f.decide(context.Background(), &swf.PollForDecisionTaskOutput{}, &EventCorrelator{}, func() ([]swf.Decision, error) {
+		return nil, wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("got err %v, want %v", err, wantErr)
+	}
+}
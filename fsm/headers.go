@@ -0,0 +1,96 @@
+package fsm
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+// HeaderCodec encodes and decodes out-of-band headers (e.g. a tracing span context or tenant id) into
+// the Input string of a ScheduleActivityTask, SignalExternalWorkflowExecution, or
+// StartChildWorkflowExecution decision, since the SWF API has no header field of its own.
+type HeaderCodec interface {
+	// Encode merges headers into body, returning the string that should be used as the Input.
+	Encode(body string, headers map[string][]byte) string
+	// Decode splits a previously-Encoded Input back into the original body and its headers. If input
+	// wasn't produced by Encode, it is returned unchanged with a nil headers map.
+	Decode(input string) (body string, headers map[string][]byte)
+}
+
+// JSONHeaderCodec is the default HeaderCodec. It wraps body and headers in a small JSON envelope tagged
+// with a magic prefix, and passes input through unchanged (with no headers) if it isn't one of its own
+// envelopes. The prefix is required because an ordinary activity/signal Input is itself often JSON, and
+// json.Unmarshal happily (and silently) decodes unrelated JSON into a zero-valued headerEnvelope.
+type JSONHeaderCodec struct{}
+
+// jsonHeaderCodecPrefix tags an Input as a JSONHeaderCodec envelope so Decode can tell it apart from an
+// ordinary (possibly JSON) activity/signal Input.
+const jsonHeaderCodecPrefix = "\x00swfsm-headers\x00"
+
+type headerEnvelope struct {
+	Body    string            `json:"body"`
+	Headers map[string][]byte `json:"headers,omitempty"`
+}
+
+// Encode implements HeaderCodec.
+func (JSONHeaderCodec) Encode(body string, headers map[string][]byte) string {
+	if len(headers) == 0 {
+		return body
+	}
+	encoded, err := json.Marshal(headerEnvelope{Body: body, Headers: headers})
+	if err != nil {
+		return body
+	}
+	return jsonHeaderCodecPrefix + string(encoded)
+}
+
+// Decode implements HeaderCodec.
+func (JSONHeaderCodec) Decode(input string) (string, map[string][]byte) {
+	if !strings.HasPrefix(input, jsonHeaderCodecPrefix) {
+		return input, nil
+	}
+	var env headerEnvelope
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(input, jsonHeaderCodecPrefix)), &env); err != nil {
+		return input, nil
+	}
+	return env.Body, env.Headers
+}
+
+// PropagateHeaders copies the headers present on startEvent's WorkflowExecutionStarted Input onto every
+// outbound ScheduleActivityTask and SignalExternalWorkflowExecution decision in decisions, so a tracing
+// span or tenant id set when the workflow started automatically flows to its activities and signals. It
+// is a no-op if f.HeaderCodec is nil.
+func (f *FSM) PropagateHeaders(startEvent swf.HistoryEvent, decisions []swf.Decision) []swf.Decision {
+	if f.HeaderCodec == nil || startEvent.WorkflowExecutionStartedEventAttributes == nil {
+		return decisions
+	}
+	input := startEvent.WorkflowExecutionStartedEventAttributes.Input
+	if input == nil {
+		return decisions
+	}
+	_, headers := f.HeaderCodec.Decode(*input)
+	if len(headers) == 0 {
+		return decisions
+	}
+
+	for _, d := range decisions {
+		switch *d.DecisionType {
+		case swf.DecisionTypeScheduleActivityTask:
+			attrs := d.ScheduleActivityTaskDecisionAttributes
+			attrs.Input = aws.String(f.HeaderCodec.Encode(stringValue(attrs.Input), headers))
+		case swf.DecisionTypeSignalExternalWorkflowExecution:
+			attrs := d.SignalExternalWorkflowExecutionDecisionAttributes
+			attrs.Input = aws.String(f.HeaderCodec.Encode(stringValue(attrs.Input), headers))
+		}
+	}
+	return decisions
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,101 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+func TestJSONHeaderCodecRoundTrip(t *testing.T) {
+	headers := map[string][]byte{"trace-id": []byte("abc123")}
+
+	encoded := JSONHeaderCodec{}.Encode("the body", headers)
+	body, got := JSONHeaderCodec{}.Decode(encoded)
+
+	if body != "the body" {
+		t.Fatalf("got body %q, want %q", body, "the body")
+	}
+	if !reflect.DeepEqual(got, headers) {
+		t.Fatalf("got headers %v, want %v", got, headers)
+	}
+}
+
+func TestJSONHeaderCodecEncodeWithNoHeadersIsUnchanged(t *testing.T) {
+	if got := (JSONHeaderCodec{}).Encode("the body", nil); got != "the body" {
+		t.Fatalf("got %q, want body unchanged when there are no headers", got)
+	}
+}
+
+func TestJSONHeaderCodecDecodeNonEnvelopeInputPassesThrough(t *testing.T) {
+	body, headers := JSONHeaderCodec{}.Decode("plain input")
+	if body != "plain input" {
+		t.Fatalf("got body %q, want plain input unchanged", body)
+	}
+	if headers != nil {
+		t.Fatalf("got headers %v, want nil for non-envelope input", headers)
+	}
+}
+
+func TestJSONHeaderCodecDecodeOrdinaryJSONInputPassesThrough(t *testing.T) {
+	// A realistic activity Input that happens to be JSON, but isn't a JSONHeaderCodec envelope. Without
+	// the magic prefix, encoding/json would happily decode this into a headerEnvelope, picking up its
+	// "body" field as the envelope body.
+	input := `{"orderId":42,"body":"should not be picked up as the envelope body"}`
+
+	body, headers := JSONHeaderCodec{}.Decode(input)
+	if body != input {
+		t.Fatalf("got body %q, want ordinary JSON input unchanged: %q", body, input)
+	}
+	if headers != nil {
+		t.Fatalf("got headers %v, want nil for non-envelope input", headers)
+	}
+}
+
+func TestPropagateHeadersCopiesStartEventHeadersOntoDecisions(t *testing.T) {
+	f := &FSM{HeaderCodec: JSONHeaderCodec{}}
+	headers := map[string][]byte{"trace-id": []byte("abc123")}
+	startInput := JSONHeaderCodec{}.Encode("start input", headers)
+
+	startEvent := swf.HistoryEvent{
+		WorkflowExecutionStartedEventAttributes: &swf.WorkflowExecutionStartedEventAttributes{
+			Input: aws.String(startInput),
+		},
+	}
+	decisions := []swf.Decision{
+		{
+			DecisionType: aws.String(swf.DecisionTypeScheduleActivityTask),
+			ScheduleActivityTaskDecisionAttributes: &swf.ScheduleActivityTaskDecisionAttributes{
+				Input: aws.String("activity input"),
+			},
+		},
+		{
+			DecisionType: aws.String(swf.DecisionTypeSignalExternalWorkflowExecution),
+			SignalExternalWorkflowExecutionDecisionAttributes: &swf.SignalExternalWorkflowExecutionDecisionAttributes{
+				Input: aws.String("signal input"),
+			},
+		},
+	}
+
+	got := f.PropagateHeaders(startEvent, decisions)
+
+	body, gotHeaders := JSONHeaderCodec{}.Decode(*got[0].ScheduleActivityTaskDecisionAttributes.Input)
+	if body != "activity input" || !reflect.DeepEqual(gotHeaders, headers) {
+		t.Fatalf("activity decision = (%q, %v), want (%q, %v)", body, gotHeaders, "activity input", headers)
+	}
+
+	body, gotHeaders = JSONHeaderCodec{}.Decode(*got[1].SignalExternalWorkflowExecutionDecisionAttributes.Input)
+	if body != "signal input" || !reflect.DeepEqual(gotHeaders, headers) {
+		t.Fatalf("signal decision = (%q, %v), want (%q, %v)", body, gotHeaders, "signal input", headers)
+	}
+}
+
+func TestPropagateHeadersNoHeaderCodecIsNoop(t *testing.T) {
+	f := &FSM{}
+	decisions := []swf.Decision{{DecisionType: aws.String(swf.DecisionTypeScheduleActivityTask)}}
+	got := f.PropagateHeaders(swf.HistoryEvent{}, decisions)
+	if !reflect.DeepEqual(got, decisions) {
+		t.Fatal("expected PropagateHeaders to return decisions unchanged when HeaderCodec is nil")
+	}
+}
@@ -0,0 +1,75 @@
+package fsm
+
+import (
+	"context"
+
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+// DecideFunc is the real work a decision task dispatch performs: deciding what Decisions to emit for
+// task, given correlator's current state. TrackFunc is the real work of folding a HistoryEvent into an
+// EventCorrelator. Both are passed to Interceptor as the next link in the chain, the way net/http
+// middleware is handed the next http.Handler, so an Interceptor can run code before AND after the real
+// call, and around any panic it raises.
+type DecideFunc func(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator) ([]swf.Decision, error)
+
+// TrackFunc is described by DecideFunc's doc comment.
+type TrackFunc func(h swf.HistoryEvent, correlator *EventCorrelator)
+
+// Interceptor is inspired by the workflow interceptor pattern in the Cadence SDK. It gives callers a
+// clean place to hang metrics, structured logging, distributed tracing spans, panic recovery, and
+// payload redaction around every decision task and every correlator mutation, without forking the
+// correlator or the decider loop. Each method wraps the real call as next, so an Interceptor can run
+// code before and after it, short-circuit it, or recover a panic it raises. Implementations should embed
+// NopInterceptor so they only need to override the hooks they care about.
+type Interceptor interface {
+	// Decide wraps a single decision task dispatch. Implementations that don't need to short-circuit or
+	// recover should just `return next(ctx, task, correlator)`.
+	Decide(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator, next DecideFunc) ([]swf.Decision, error)
+	// Track wraps folding a HistoryEvent into an EventCorrelator. Implementations that don't need to
+	// short-circuit or recover should just `next(h, correlator)`.
+	Track(h swf.HistoryEvent, correlator *EventCorrelator, next TrackFunc)
+}
+
+// NopInterceptor is a no-op implementation of Interceptor that just calls through to next. Embed it in
+// your own interceptor type so you only have to implement the hooks you actually need.
+type NopInterceptor struct{}
+
+func (NopInterceptor) Decide(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator, next DecideFunc) ([]swf.Decision, error) {
+	return next(ctx, task, correlator)
+}
+
+func (NopInterceptor) Track(h swf.HistoryEvent, correlator *EventCorrelator, next TrackFunc) {
+	next(h, correlator)
+}
+
+// composeInterceptors folds interceptors into a single DecideFunc that wraps real around
+// each interceptor in turn, so interceptors[0] is outermost: it runs first, calls next to invoke
+// interceptors[1], and so on until the innermost next invokes real itself. This is the same nesting
+// net/http middleware chains use, and it means an outer interceptor's deferred recover() guards
+// everything inside it, including real and every interceptor between it and real.
+func composeInterceptors(interceptors []Interceptor, real DecideFunc) DecideFunc {
+	next := real
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		i := i
+		wrapped := next
+		next = func(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator) ([]swf.Decision, error) {
+			return interceptors[i].Decide(ctx, task, correlator, wrapped)
+		}
+	}
+	return next
+}
+
+// composeTrackInterceptors is composeInterceptors's counterpart for Track; see its doc comment for the
+// wrapping order.
+func composeTrackInterceptors(interceptors []Interceptor, real TrackFunc) TrackFunc {
+	next := real
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		i := i
+		wrapped := next
+		next = func(h swf.HistoryEvent, correlator *EventCorrelator) {
+			interceptors[i].Track(h, correlator, wrapped)
+		}
+	}
+	return next
+}
@@ -0,0 +1,110 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+// orderInterceptor records name into order before and after calling next, so tests can assert wrapping
+// order without needing real metrics/tracing behavior.
+type orderInterceptor struct {
+	NopInterceptor
+	name  string
+	order *[]string
+}
+
+func (o orderInterceptor) Decide(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator, next DecideFunc) ([]swf.Decision, error) {
+	*o.order = append(*o.order, "before:"+o.name)
+	decisions, err := next(ctx, task, correlator)
+	*o.order = append(*o.order, "after:"+o.name)
+	return decisions, err
+}
+
+func (o orderInterceptor) Track(h swf.HistoryEvent, correlator *EventCorrelator, next TrackFunc) {
+	*o.order = append(*o.order, "before:"+o.name)
+	next(h, correlator)
+	*o.order = append(*o.order, "after:"+o.name)
+}
+
+func TestComposeInterceptorsWrapsOutermostFirst(t *testing.T) {
+	var order []string
+	interceptors := []Interceptor{
+		orderInterceptor{name: "outer", order: &order},
+		orderInterceptor{name: "inner", order: &order},
+	}
+	chain := composeInterceptors(interceptors, func(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator) ([]swf.Decision, error) {
+		order = append(order, "real")
+		return nil, nil
+	})
+
+	if _, err := chain(context.Background(), &swf.PollForDecisionTaskOutput{}, &EventCorrelator{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"before:outer", "before:inner", "real", "after:inner", "after:outer"}
+	assertOrder(t, order, want)
+}
+
+func TestComposeTrackInterceptorsWrapsOutermostFirst(t *testing.T) {
+	var order []string
+	interceptors := []Interceptor{
+		orderInterceptor{name: "outer", order: &order},
+		orderInterceptor{name: "inner", order: &order},
+	}
+	chain := composeTrackInterceptors(interceptors, func(h swf.HistoryEvent, correlator *EventCorrelator) {
+		order = append(order, "real")
+	})
+
+	chain(swf.HistoryEvent{}, &EventCorrelator{})
+
+	want := []string{"before:outer", "before:inner", "real", "after:inner", "after:outer"}
+	assertOrder(t, order, want)
+}
+
+// recoveringInterceptor demonstrates why next must wrap the real call rather than merely bracket it:
+// a deferred recover() here can only save the caller from a panic inside next.
+type recoveringInterceptor struct {
+	NopInterceptor
+	recovered *interface{}
+}
+
+func (r recoveringInterceptor) Decide(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator, next DecideFunc) (decisions []swf.Decision, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			*r.recovered = p
+			err = fmt.Errorf("fsm: recovered panic: %v", p)
+		}
+	}()
+	return next(ctx, task, correlator)
+}
+
+func TestComposeInterceptorsRecoversPanicInNext(t *testing.T) {
+	var recovered interface{}
+	interceptors := []Interceptor{recoveringInterceptor{recovered: &recovered}}
+	chain := composeInterceptors(interceptors, func(ctx context.Context, task *swf.PollForDecisionTaskOutput, correlator *EventCorrelator) ([]swf.Decision, error) {
+		panic("boom")
+	})
+
+	_, err := chain(context.Background(), &swf.PollForDecisionTaskOutput{}, &EventCorrelator{})
+	if err == nil {
+		t.Fatal("expected an error recovered from the panicking decision")
+	}
+	if recovered != "boom" {
+		t.Fatalf("recovered = %v, want boom", recovered)
+	}
+}
+
+func assertOrder(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("order = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package fsm
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+// RetryPolicy describes how an activity or signal should be retried after a failure.
+// It mirrors the retry policy model used by Cadence/Temporal: a backoff that grows
+// from InitialInterval by BackoffCoefficient on each attempt, capped at MaximumInterval,
+// up to MaximumAttempts (0 means unlimited) or until ExpirationInterval has elapsed
+// since the first attempt (0 means no expiration). Failures whose reason matches one
+// of NonRetriableErrorTypes are never retried.
+type RetryPolicy struct {
+	InitialInterval        time.Duration
+	BackoffCoefficient     float64
+	MaximumInterval        time.Duration
+	MaximumAttempts        int
+	ExpirationInterval     time.Duration
+	NonRetriableErrorTypes []string
+}
+
+// RetryPolicyForActivity returns the RetryPolicy registered for a given activity type name, or nil if none was set.
+func (a *EventCorrelator) RetryPolicyForActivity(activityName string) *RetryPolicy {
+	if a.ActivityRetryPolicies == nil {
+		return nil
+	}
+	return a.ActivityRetryPolicies[activityName]
+}
+
+// RetryPolicyForSignal returns the RetryPolicy registered for a given signal name, or nil if none was set.
+func (a *EventCorrelator) RetryPolicyForSignal(signalName string) *RetryPolicy {
+	if a.SignalRetryPolicies == nil {
+		return nil
+	}
+	return a.SignalRetryPolicies[signalName]
+}
+
+// AddActivityRetryPolicy attaches a RetryPolicy to every activity of the given activity type name.
+func (a *EventCorrelator) AddActivityRetryPolicy(activityName string, policy *RetryPolicy) {
+	a.checkInit()
+	if a.ActivityRetryPolicies == nil {
+		a.ActivityRetryPolicies = make(map[string]*RetryPolicy)
+	}
+	a.ActivityRetryPolicies[activityName] = policy
+}
+
+// AddSignalRetryPolicy attaches a RetryPolicy to every signal with the given signal name.
+func (a *EventCorrelator) AddSignalRetryPolicy(signalName string, policy *RetryPolicy) {
+	a.checkInit()
+	if a.SignalRetryPolicies == nil {
+		a.SignalRetryPolicies = make(map[string]*RetryPolicy)
+	}
+	a.SignalRetryPolicies[signalName] = policy
+}
+
+// NextRetryDelay computes how long to wait before retrying the activity described by info, given the
+// failure event h and the reason its last attempt failed. It returns false when no further retry should
+// be attempted, because the policy's MaximumAttempts or ExpirationInterval has been exceeded,
+// lastFailureReason matches one of its NonRetriableErrorTypes, or no RetryPolicy is registered for info's
+// activity type. h's EventTimestamp, not wall-clock time, is used to evaluate ExpirationInterval, so a
+// Decider replaying the same history always reaches the same decision.
+func (a *EventCorrelator) NextRetryDelay(info *ActivityInfo, h swf.HistoryEvent, lastFailureReason string) (time.Duration, bool) {
+	policy := a.RetryPolicyForActivity(*info.ActivityType.Name)
+	if policy == nil {
+		return 0, false
+	}
+	attempts := a.AttemptsForActivity(info)
+	firstAttempt := a.ActivityFirstAttempts[info.ActivityID]
+	return policy.nextDelay(attempts, firstAttempt, eventTime(h), lastFailureReason)
+}
+
+// NextRetryDelayForSignal computes how long to wait before retrying the signal described by info, given
+// the failure event h and the reason its last attempt failed. See NextRetryDelay for the conditions under
+// which it returns false and how h is used.
+func (a *EventCorrelator) NextRetryDelayForSignal(info *SignalInfo, h swf.HistoryEvent, lastFailureReason string) (time.Duration, bool) {
+	policy := a.RetryPolicyForSignal(info.SignalName)
+	if policy == nil {
+		return 0, false
+	}
+	attempts := a.AttemptsForSignal(info)
+	firstAttempt := a.SignalFirstAttempts[a.signalIDFromInfo(info)]
+	return policy.nextDelay(attempts, firstAttempt, eventTime(h), lastFailureReason)
+}
+
+func (p *RetryPolicy) nextDelay(attempts int, firstAttempt, now time.Time, lastFailureReason string) (time.Duration, bool) {
+	for _, t := range p.NonRetriableErrorTypes {
+		if t == lastFailureReason {
+			return 0, false
+		}
+	}
+
+	nextAttempt := attempts + 1
+	if p.MaximumAttempts > 0 && nextAttempt > p.MaximumAttempts {
+		return 0, false
+	}
+
+	delay := time.Duration(float64(p.InitialInterval) * math.Pow(p.BackoffCoefficient, float64(attempts)))
+	if p.MaximumInterval > 0 && delay > p.MaximumInterval {
+		delay = p.MaximumInterval
+	}
+
+	if p.ExpirationInterval > 0 && !firstAttempt.IsZero() {
+		if firstAttempt.Add(p.ExpirationInterval).Before(now.Add(delay)) {
+			return 0, false
+		}
+	}
+
+	return delay, true
+}
+
+// RetryTimerID is the convention used to name the StartTimer decision produced by RetryActivityDecision,
+// so that the corresponding TimerFired event can be matched back to the activity it should reschedule.
+func RetryTimerID(activityID string) string {
+	return "retry->" + activityID
+}
+
+// RetryActivityDecision builds the StartTimer decision that should be emitted in place of immediately
+// rescheduling a failed activity. The activity should actually be rescheduled with ScheduleActivityTask
+// when the matching TimerFired event (TimerID == RetryTimerID(info.ActivityID)) is seen by the Decider.
+//
+// There is deliberately no corresponding helper to build that ScheduleActivityTask decision: ActivityInfo
+// only retains ActivityID, ActivityType, and Headers, not the TaskList, Input, or timeouts the original
+// decision used, so this package has nothing to rebuild it from. A Decider must keep whatever it needs to
+// reschedule the activity (e.g. alongside its own copy of the original decision, keyed by ActivityID) and
+// emit ScheduleActivityTask itself once it sees the TimerFired.
+func RetryActivityDecision(info *ActivityInfo, delay time.Duration) *swf.Decision {
+	return &swf.Decision{
+		DecisionType: aws.String(swf.DecisionTypeStartTimer),
+		StartTimerDecisionAttributes: &swf.StartTimerDecisionAttributes{
+			TimerID:            aws.String(RetryTimerID(info.ActivityID)),
+			StartToFireTimeout: aws.String(secondsString(delay)),
+		},
+	}
+}
+
+func secondsString(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
@@ -0,0 +1,105 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+func failedEventAt(t time.Time) swf.HistoryEvent {
+	ts := float64(t.Unix())
+	return swf.HistoryEvent{EventTimestamp: &ts}
+}
+
+func TestNextRetryDelayBackoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialInterval:    time.Second,
+		BackoffCoefficient: 2.0,
+		MaximumInterval:    10 * time.Second,
+	}
+	c := &EventCorrelator{}
+	c.AddActivityRetryPolicy("widgetify", policy)
+	info := &ActivityInfo{ActivityID: "a1", ActivityType: &swf.ActivityType{Name: aws.String("widgetify")}}
+	c.checkInit()
+	c.ActivityFirstAttempts[info.ActivityID] = time.Unix(1000, 0)
+
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second}, // clamped to MaximumInterval
+	}
+	for _, tc := range cases {
+		c.ActivityAttempts[info.ActivityID] = tc.attempts
+		got, ok := c.NextRetryDelay(info, failedEventAt(time.Unix(1000, 0)), "boom")
+		if !ok {
+			t.Fatalf("attempts=%d: expected a retry", tc.attempts)
+		}
+		if got != tc.want {
+			t.Errorf("attempts=%d: got delay %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestNextRetryDelayMaximumAttempts(t *testing.T) {
+	c := &EventCorrelator{}
+	c.AddActivityRetryPolicy("widgetify", &RetryPolicy{
+		InitialInterval: time.Second,
+		MaximumAttempts: 3,
+	})
+	info := &ActivityInfo{ActivityID: "a1", ActivityType: &swf.ActivityType{Name: aws.String("widgetify")}}
+	c.checkInit()
+	c.ActivityAttempts[info.ActivityID] = 3
+
+	if _, ok := c.NextRetryDelay(info, failedEventAt(time.Unix(1000, 0)), "boom"); ok {
+		t.Fatal("expected no further retry once MaximumAttempts is reached")
+	}
+}
+
+func TestNextRetryDelayNonRetriableErrorType(t *testing.T) {
+	c := &EventCorrelator{}
+	c.AddActivityRetryPolicy("widgetify", &RetryPolicy{
+		InitialInterval:        time.Second,
+		NonRetriableErrorTypes: []string{"FatalError"},
+	})
+	info := &ActivityInfo{ActivityID: "a1", ActivityType: &swf.ActivityType{Name: aws.String("widgetify")}}
+
+	if _, ok := c.NextRetryDelay(info, failedEventAt(time.Unix(1000, 0)), "FatalError"); ok {
+		t.Fatal("expected no retry for a non-retriable error type")
+	}
+}
+
+// TestNextRetryDelayExpirationUsesEventTimestamp confirms the ExpirationInterval check is driven by the
+// failing HistoryEvent's EventTimestamp, not wall-clock time, so a Decider reaches the same decision no
+// matter when it happens to replay the history.
+func TestNextRetryDelayExpirationUsesEventTimestamp(t *testing.T) {
+	c := &EventCorrelator{}
+	c.AddActivityRetryPolicy("widgetify", &RetryPolicy{
+		InitialInterval:    time.Second,
+		ExpirationInterval: time.Minute,
+	})
+	info := &ActivityInfo{ActivityID: "a1", ActivityType: &swf.ActivityType{Name: aws.String("widgetify")}}
+	c.checkInit()
+	firstAttempt := time.Unix(1000, 0)
+	c.ActivityFirstAttempts[info.ActivityID] = firstAttempt
+
+	// Well within ExpirationInterval of firstAttempt: should still retry, regardless of how much real
+	// wall-clock time has passed since the test started running.
+	withinExpiration := failedEventAt(firstAttempt.Add(30 * time.Second))
+	if _, ok := c.NextRetryDelay(info, withinExpiration, "boom"); !ok {
+		t.Fatal("expected a retry when the failure event is within ExpirationInterval")
+	}
+
+	// Past ExpirationInterval of firstAttempt: should stop retrying, even though wall-clock "now" is
+	// nowhere near that time.
+	pastExpiration := failedEventAt(firstAttempt.Add(2 * time.Minute))
+	if _, ok := c.NextRetryDelay(info, pastExpiration, "boom"); ok {
+		t.Fatal("expected no retry once the failure event is past ExpirationInterval")
+	}
+}
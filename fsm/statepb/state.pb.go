@@ -0,0 +1,85 @@
+// Package statepb mirrors the wire representation of an fsm.EventCorrelator that state.proto describes.
+// It is hand-maintained rather than protoc-generated: this tree has no protoc available, so keep it in
+// sync with state.proto by hand when either changes.
+
+package statepb
+
+import "fmt"
+
+// State is the wire representation of an fsm.EventCorrelator.
+type State struct {
+	Activities            map[string]*ActivityInfo      `protobuf:"bytes,1,rep,name=activities" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"activities,omitempty"`
+	ActivityAttempts      map[string]int64               `protobuf:"bytes,2,rep,name=activity_attempts,json=activityAttempts" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value" json:"activity_attempts,omitempty"`
+	ActivityFirstAttempts map[string]int64               `protobuf:"bytes,3,rep,name=activity_first_attempts,json=activityFirstAttempts" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value" json:"activity_first_attempts,omitempty"`
+	Signals               map[string]*SignalInfo        `protobuf:"bytes,4,rep,name=signals" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"signals,omitempty"`
+	SignalAttempts        map[string]int64               `protobuf:"bytes,5,rep,name=signal_attempts,json=signalAttempts" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value" json:"signal_attempts,omitempty"`
+	SignalFirstAttempts   map[string]int64               `protobuf:"bytes,6,rep,name=signal_first_attempts,json=signalFirstAttempts" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value" json:"signal_first_attempts,omitempty"`
+	ChildWorkflows        map[string]*ChildWorkflowInfo `protobuf:"bytes,7,rep,name=child_workflows,json=childWorkflows" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"child_workflows,omitempty"`
+	ChildWorkflowAttempts map[string]int64               `protobuf:"bytes,8,rep,name=child_workflow_attempts,json=childWorkflowAttempts" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value" json:"child_workflow_attempts,omitempty"`
+	Timers                map[string]*TimerInfo          `protobuf:"bytes,9,rep,name=timers" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"timers,omitempty"`
+	ActivityRetryPolicies map[string]*RetryPolicy       `protobuf:"bytes,10,rep,name=activity_retry_policies,json=activityRetryPolicies" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"activity_retry_policies,omitempty"`
+	SignalRetryPolicies   map[string]*RetryPolicy       `protobuf:"bytes,11,rep,name=signal_retry_policies,json=signalRetryPolicies" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"signal_retry_policies,omitempty"`
+}
+
+func (m *State) Reset()         { *m = State{} }
+func (m *State) String() string { return fmt.Sprintf("%+v", *m) }
+func (*State) ProtoMessage()    {}
+
+// ActivityInfo is the wire representation of an fsm.ActivityInfo.
+type ActivityInfo struct {
+	ActivityID          string            `protobuf:"bytes,1,opt,name=activity_id,json=activityId" json:"activity_id,omitempty"`
+	ActivityTypeName    string            `protobuf:"bytes,2,opt,name=activity_type_name,json=activityTypeName" json:"activity_type_name,omitempty"`
+	ActivityTypeVersion string            `protobuf:"bytes,3,opt,name=activity_type_version,json=activityTypeVersion" json:"activity_type_version,omitempty"`
+	Headers             map[string][]byte `protobuf:"bytes,4,rep,name=headers" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"headers,omitempty"`
+}
+
+func (m *ActivityInfo) Reset()         { *m = ActivityInfo{} }
+func (m *ActivityInfo) String() string { return fmt.Sprintf("%+v", *m) }
+func (*ActivityInfo) ProtoMessage()    {}
+
+// SignalInfo is the wire representation of an fsm.SignalInfo.
+type SignalInfo struct {
+	SignalName string            `protobuf:"bytes,1,opt,name=signal_name,json=signalName" json:"signal_name,omitempty"`
+	WorkflowID string            `protobuf:"bytes,2,opt,name=workflow_id,json=workflowId" json:"workflow_id,omitempty"`
+	Headers    map[string][]byte `protobuf:"bytes,3,rep,name=headers" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"headers,omitempty"`
+}
+
+func (m *SignalInfo) Reset()         { *m = SignalInfo{} }
+func (m *SignalInfo) String() string { return fmt.Sprintf("%+v", *m) }
+func (*SignalInfo) ProtoMessage()    {}
+
+// ChildWorkflowInfo is the wire representation of an fsm.ChildWorkflowInfo.
+type ChildWorkflowInfo struct {
+	WorkflowID          string            `protobuf:"bytes,1,opt,name=workflow_id,json=workflowId" json:"workflow_id,omitempty"`
+	RunID               string            `protobuf:"bytes,2,opt,name=run_id,json=runId" json:"run_id,omitempty"`
+	WorkflowTypeName    string            `protobuf:"bytes,3,opt,name=workflow_type_name,json=workflowTypeName" json:"workflow_type_name,omitempty"`
+	WorkflowTypeVersion string            `protobuf:"bytes,4,opt,name=workflow_type_version,json=workflowTypeVersion" json:"workflow_type_version,omitempty"`
+	Headers             map[string][]byte `protobuf:"bytes,5,rep,name=headers" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"headers,omitempty"`
+}
+
+func (m *ChildWorkflowInfo) Reset()         { *m = ChildWorkflowInfo{} }
+func (m *ChildWorkflowInfo) String() string { return fmt.Sprintf("%+v", *m) }
+func (*ChildWorkflowInfo) ProtoMessage()    {}
+
+// TimerInfo is the wire representation of an fsm.TimerInfo.
+type TimerInfo struct {
+	TimerID string `protobuf:"bytes,1,opt,name=timer_id,json=timerId" json:"timer_id,omitempty"`
+}
+
+func (m *TimerInfo) Reset()         { *m = TimerInfo{} }
+func (m *TimerInfo) String() string { return fmt.Sprintf("%+v", *m) }
+func (*TimerInfo) ProtoMessage()    {}
+
+// RetryPolicy is the wire representation of an fsm.RetryPolicy.
+type RetryPolicy struct {
+	InitialIntervalNanos    int64    `protobuf:"varint,1,opt,name=initial_interval_nanos,json=initialIntervalNanos" json:"initial_interval_nanos,omitempty"`
+	BackoffCoefficient      float64  `protobuf:"fixed64,2,opt,name=backoff_coefficient,json=backoffCoefficient" json:"backoff_coefficient,omitempty"`
+	MaximumIntervalNanos    int64    `protobuf:"varint,3,opt,name=maximum_interval_nanos,json=maximumIntervalNanos" json:"maximum_interval_nanos,omitempty"`
+	MaximumAttempts         int64    `protobuf:"varint,4,opt,name=maximum_attempts,json=maximumAttempts" json:"maximum_attempts,omitempty"`
+	ExpirationIntervalNanos int64    `protobuf:"varint,5,opt,name=expiration_interval_nanos,json=expirationIntervalNanos" json:"expiration_interval_nanos,omitempty"`
+	NonRetriableErrorTypes  []string `protobuf:"bytes,6,rep,name=non_retriable_error_types,json=nonRetriableErrorTypes" json:"non_retriable_error_types,omitempty"`
+}
+
+func (m *RetryPolicy) Reset()         { *m = RetryPolicy{} }
+func (m *RetryPolicy) String() string { return fmt.Sprintf("%+v", *m) }
+func (*RetryPolicy) ProtoMessage()    {}
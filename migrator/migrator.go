@@ -0,0 +1,268 @@
+// Package migrator provisions the SWF domains, workflow/activity types, and Kinesis streams a worker
+// needs before it can run, from a declarative list of register/deprecate requests.
+package migrator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/kinesis"
+	"github.com/awslabs/aws-sdk-go/gen/swf"
+)
+
+// defaultPollInterval is used when a Migrator has a Timeout but no PollInterval of its own.
+const defaultPollInterval = 1 * time.Second
+
+// TimeoutError is returned by Migrate when a resource it created didn't become ready before Timeout
+// elapsed.
+type TimeoutError struct {
+	Resource string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("migrator: timed out waiting for %s to become ready", e.Resource)
+}
+
+// awsError is satisfied by the errors the generated SWF/Kinesis clients return, letting Migrate tell an
+// AlreadyExists- or AlreadyDeprecated-style fault (safe to ignore, since Migrate is meant to be called repeatedly) from a real
+// failure.
+type awsError interface {
+	Code() string
+}
+
+func isAlreadyExists(err error) bool {
+	aerr, ok := err.(awsError)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case "DomainAlreadyExistsFault", "TypeAlreadyExistsFault", "WorkflowTypeAlreadyExistsFault",
+		"ResourceInUseException", "DomainDeprecatedFault", "TypeDeprecatedFault":
+		return true
+	}
+	return false
+}
+
+// pollUntil calls check repeatedly, sleeping interval (or defaultPollInterval, if interval is zero)
+// between calls, until check reports ready, returns an error, or timeout elapses since pollUntil was
+// called, in which case it returns a *TimeoutError naming resource. A zero timeout disables waiting
+// entirely and pollUntil returns immediately without calling check.
+func pollUntil(resource string, timeout, interval time.Duration, check func() (ready bool, err error)) error {
+	if timeout <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ready, err := check()
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &TimeoutError{Resource: resource}
+		}
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		time.Sleep(interval)
+	}
+}
+
+// DomainMigrator registers and deprecates a set of SWF domains.
+type DomainMigrator struct {
+	RegisteredDomains []swf.RegisterDomainInput
+	DeprecatedDomains []swf.DeprecateDomainInput
+	Client            *swf.SWF
+
+	// Timeout, if set, bounds how long Migrate waits for each registered domain to report
+	// RegistrationStatus REGISTERED before returning a *TimeoutError. Zero means don't wait at all.
+	Timeout time.Duration
+	// PollInterval is how often Migrate polls DescribeDomain while waiting. Defaults to one second.
+	PollInterval time.Duration
+}
+
+// Migrate registers every domain in RegisteredDomains and deprecates every domain in DeprecatedDomains,
+// ignoring faults that indicate the domain is already in the desired state so Migrate is safe to call
+// more than once. If Timeout is set, it then polls every registered domain, in parallel with its own
+// wait budget, until SWF reports it REGISTERED or Timeout elapses.
+func (d *DomainMigrator) Migrate() error {
+	for _, req := range d.RegisteredDomains {
+		if _, err := d.Client.RegisterDomain(&req); err != nil && !isAlreadyExists(err) {
+			return err
+		}
+	}
+	for _, req := range d.DeprecatedDomains {
+		if _, err := d.Client.DeprecateDomain(&req); err != nil && !isAlreadyExists(err) {
+			return err
+		}
+	}
+	waits := make([]func() error, len(d.RegisteredDomains))
+	for i, req := range d.RegisteredDomains {
+		req := req
+		waits[i] = func() error {
+			return pollUntil(*req.Name, d.Timeout, d.PollInterval, func() (bool, error) {
+				out, err := d.Client.DescribeDomain(&swf.DescribeDomainInput{Name: req.Name})
+				if err != nil {
+					return false, err
+				}
+				return out.DomainInfo != nil && out.DomainInfo.Status != nil && *out.DomainInfo.Status == "REGISTERED", nil
+			})
+		}
+	}
+	return awaitAll(waits)
+}
+
+// WorkflowTypeMigrator registers and deprecates a set of SWF workflow types.
+type WorkflowTypeMigrator struct {
+	RegisteredWorkflowTypes []swf.RegisterWorkflowTypeInput
+	DeprecatedWorkflowTypes []swf.DeprecateWorkflowTypeInput
+	Client                  *swf.SWF
+
+	// Timeout, if set, bounds how long Migrate waits for each registered workflow type to report
+	// RegistrationStatus REGISTERED before returning a *TimeoutError. Zero means don't wait at all.
+	Timeout time.Duration
+	// PollInterval is how often Migrate polls DescribeWorkflowType while waiting. Defaults to one second.
+	PollInterval time.Duration
+}
+
+// Migrate registers every workflow type in RegisteredWorkflowTypes and deprecates every workflow type in
+// DeprecatedWorkflowTypes, ignoring faults that indicate the workflow type is already in the desired
+// state so Migrate is safe to call more than once. If Timeout is set, it then polls every registered
+// workflow type, in parallel with its own wait budget, until SWF reports it REGISTERED or Timeout elapses.
+func (w *WorkflowTypeMigrator) Migrate() error {
+	for _, req := range w.RegisteredWorkflowTypes {
+		if _, err := w.Client.RegisterWorkflowType(&req); err != nil && !isAlreadyExists(err) {
+			return err
+		}
+	}
+	for _, req := range w.DeprecatedWorkflowTypes {
+		if _, err := w.Client.DeprecateWorkflowType(&req); err != nil && !isAlreadyExists(err) {
+			return err
+		}
+	}
+	waits := make([]func() error, len(w.RegisteredWorkflowTypes))
+	for i, req := range w.RegisteredWorkflowTypes {
+		req := req
+		waits[i] = func() error {
+			describe := &swf.DescribeWorkflowTypeInput{
+				Domain:       req.Domain,
+				WorkflowType: &swf.WorkflowType{Name: req.Name, Version: req.Version},
+			}
+			return pollUntil(*req.Name, w.Timeout, w.PollInterval, func() (bool, error) {
+				out, err := w.Client.DescribeWorkflowType(describe)
+				if err != nil {
+					return false, err
+				}
+				return out.TypeInfo != nil && out.TypeInfo.Status != nil && *out.TypeInfo.Status == "REGISTERED", nil
+			})
+		}
+	}
+	return awaitAll(waits)
+}
+
+// ActivityTypeMigrator registers and deprecates a set of SWF activity types.
+type ActivityTypeMigrator struct {
+	RegisteredActivityTypes []swf.RegisterActivityTypeInput
+	DeprecatedActivityTypes []swf.DeprecateActivityTypeInput
+	Client                  *swf.SWF
+
+	// Timeout, if set, bounds how long Migrate waits for each registered activity type to report
+	// RegistrationStatus REGISTERED before returning a *TimeoutError. Zero means don't wait at all.
+	Timeout time.Duration
+	// PollInterval is how often Migrate polls DescribeActivityType while waiting. Defaults to one second.
+	PollInterval time.Duration
+}
+
+// Migrate registers every activity type in RegisteredActivityTypes and deprecates every activity type in
+// DeprecatedActivityTypes, ignoring faults that indicate the activity type is already in the desired
+// state so Migrate is safe to call more than once. If Timeout is set, it then polls every registered
+// activity type, in parallel with its own wait budget, until SWF reports it REGISTERED or Timeout elapses.
+func (a *ActivityTypeMigrator) Migrate() error {
+	for _, req := range a.RegisteredActivityTypes {
+		if _, err := a.Client.RegisterActivityType(&req); err != nil && !isAlreadyExists(err) {
+			return err
+		}
+	}
+	for _, req := range a.DeprecatedActivityTypes {
+		if _, err := a.Client.DeprecateActivityType(&req); err != nil && !isAlreadyExists(err) {
+			return err
+		}
+	}
+	waits := make([]func() error, len(a.RegisteredActivityTypes))
+	for i, req := range a.RegisteredActivityTypes {
+		req := req
+		waits[i] = func() error {
+			describe := &swf.DescribeActivityTypeInput{
+				Domain:       req.Domain,
+				ActivityType: &swf.ActivityType{Name: req.Name, Version: req.Version},
+			}
+			return pollUntil(*req.Name, a.Timeout, a.PollInterval, func() (bool, error) {
+				out, err := a.Client.DescribeActivityType(describe)
+				if err != nil {
+					return false, err
+				}
+				return out.TypeInfo != nil && out.TypeInfo.Status != nil && *out.TypeInfo.Status == "REGISTERED", nil
+			})
+		}
+	}
+	return awaitAll(waits)
+}
+
+// StreamMigrator creates a set of Kinesis streams.
+type StreamMigrator struct {
+	Streams []kinesis.CreateStreamInput
+	Client  *kinesis.Kinesis
+
+	// Timeout, if set, bounds how long Migrate waits for each created stream to reach StreamStatus
+	// ACTIVE before returning a *TimeoutError. Zero means don't wait at all.
+	Timeout time.Duration
+	// PollInterval is how often Migrate polls DescribeStream while waiting. Defaults to one second.
+	PollInterval time.Duration
+}
+
+// Migrate creates every stream in Streams, ignoring a ResourceInUseException so Migrate is safe to call
+// more than once. If Timeout is set, it then polls every created stream, in parallel with its own wait
+// budget, until Kinesis reports it ACTIVE or Timeout elapses.
+func (s *StreamMigrator) Migrate() error {
+	for _, req := range s.Streams {
+		if _, err := s.Client.CreateStream(&req); err != nil && !isAlreadyExists(err) {
+			return err
+		}
+	}
+	waits := make([]func() error, len(s.Streams))
+	for i, req := range s.Streams {
+		req := req
+		waits[i] = func() error {
+			return pollUntil(*req.StreamName, s.Timeout, s.PollInterval, func() (bool, error) {
+				out, err := s.Client.DescribeStream(&kinesis.DescribeStreamInput{StreamName: req.StreamName})
+				if err != nil {
+					return false, err
+				}
+				return out.StreamDescription != nil && out.StreamDescription.StreamStatus != nil &&
+					*out.StreamDescription.StreamStatus == "ACTIVE", nil
+			})
+		}
+	}
+	return awaitAll(waits)
+}
+
+// awaitAll runs each of waits concurrently, so Migrate's total wait time for N just-registered resources
+// is bounded by the slowest one to become ready rather than the sum of all of them. It returns the first
+// error any wait reports.
+func awaitAll(waits []func() error) error {
+	errs := make(chan error, len(waits))
+	for _, wait := range waits {
+		wait := wait
+		go func() { errs <- wait() }()
+	}
+	var firstErr error
+	for range waits {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -164,3 +164,92 @@ func TestMigrateStreams(t *testing.T) {
 	sm.Migrate()
 
 }
+
+func TestPollUntilZeroTimeoutReturnsImmediatelyWithoutCalling(t *testing.T) {
+	called := false
+	err := pollUntil("resource", 0, 0, func() (bool, error) {
+		called = true
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("pollUntil with zero timeout: %v", err)
+	}
+	if called {
+		t.Fatal("expected pollUntil with a zero timeout to never call check")
+	}
+}
+
+func TestPollUntilReturnsOnceCheckReportsReady(t *testing.T) {
+	calls := 0
+	err := pollUntil("resource", time.Second, time.Millisecond, func() (bool, error) {
+		calls++
+		return calls >= 3, nil
+	})
+	if err != nil {
+		t.Fatalf("pollUntil: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("got %d calls, want 3", calls)
+	}
+}
+
+func TestPollUntilReturnsCheckError(t *testing.T) {
+	wantErr := fmt.Errorf("describe failed")
+	err := pollUntil("resource", time.Second, time.Millisecond, func() (bool, error) {
+		return false, wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("got err %v, want %v", err, wantErr)
+	}
+}
+
+func TestPollUntilReturnsTimeoutErrorOnDeadline(t *testing.T) {
+	err := pollUntil("my-resource", 5*time.Millisecond, time.Millisecond, func() (bool, error) {
+		return false, nil
+	})
+	terr, ok := err.(*TimeoutError)
+	if !ok {
+		t.Fatalf("got err %v (%T), want *TimeoutError", err, err)
+	}
+	if terr.Resource != "my-resource" {
+		t.Fatalf("got TimeoutError.Resource %q, want my-resource", terr.Resource)
+	}
+}
+
+func TestAwaitAllReturnsFirstError(t *testing.T) {
+	wantErr := fmt.Errorf("boom")
+	err := awaitAll([]func() error{
+		func() error { return nil },
+		func() error { return wantErr },
+		func() error { return nil },
+	})
+	if err != wantErr {
+		t.Fatalf("got err %v, want %v", err, wantErr)
+	}
+}
+
+func TestAwaitAllRunsConcurrentlyAndReturnsNilWhenAllSucceed(t *testing.T) {
+	const n = 8
+	started := make(chan struct{}, n)
+	release := make(chan struct{})
+	waits := make([]func() error, n)
+	for i := 0; i < n; i++ {
+		waits[i] = func() error {
+			started <- struct{}{}
+			<-release
+			return nil
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- awaitAll(waits) }()
+
+	for i := 0; i < n; i++ {
+		<-started
+	}
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("got err %v, want nil", err)
+	}
+}